@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tomcz/ssr-chatbots/marvin-golang/store"
+)
+
+// Backend generates a reply to prompt, streaming incremental chunks of text
+// onto tokens as they become available. history carries the conversation
+// so far, oldest first, so a Backend can produce contextual answers.
+// Backend implementations must close tokens before returning, and must
+// stop promptly when ctx is cancelled.
+type Backend interface {
+	Ask(ctx context.Context, prompt string, history []store.Message, tokens chan<- string) error
+}
+
+// newBackend selects a Backend implementation based on the BACKEND env var.
+// Supported values are "openai", "ollama", and "canned" (the default).
+func newBackend() (Backend, error) {
+	switch name := os.Getenv("BACKEND"); name {
+	case "", "canned":
+		return cannedBackend{}, nil
+	case "openai":
+		return newOpenAIBackend(), nil
+	case "ollama":
+		return newOllamaBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown BACKEND %q", name)
+	}
+}
+
+// cannedBackend preserves the original behaviour of sleeping for a couple of
+// seconds and then returning a random Marvin quote.
+type cannedBackend struct{}
+
+func (cannedBackend) Ask(ctx context.Context, _ string, _ []store.Message, tokens chan<- string) error {
+	defer close(tokens)
+	select {
+	case <-time.After(2 * time.Second): // pretend to be a busy LLM
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	msg := cannedResponses[rand.IntN(len(cannedResponses))]
+	select {
+	case tokens <- msg:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+const (
+	defaultOpenAIBaseURL = "https://api.openai.com/v1"
+	defaultOpenAIModel   = "gpt-4o-mini"
+	defaultOllamaBaseURL = "http://localhost:11434"
+	defaultOllamaModel   = "llama3"
+)
+
+// openaiBackend talks to any OpenAI-compatible chat completions API,
+// streaming the response via server-sent events.
+type openaiBackend struct {
+	baseURL string
+	model   string
+	apiKey  string
+	client  *http.Client
+}
+
+func newOpenAIBackend() *openaiBackend {
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	model := os.Getenv("MODEL")
+	if model == "" {
+		model = defaultOpenAIModel
+	}
+	return &openaiBackend{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		model:   model,
+		apiKey:  os.Getenv("API_KEY"),
+		client:  &http.Client{},
+	}
+}
+
+func (b *openaiBackend) Ask(ctx context.Context, prompt string, history []store.Message, tokens chan<- string) error {
+	defer close(tokens)
+
+	messages := make([]map[string]string, 0, len(history)+1)
+	for _, msg := range history {
+		role := "user"
+		if msg.Source == "bot" {
+			role = "assistant"
+		}
+		messages = append(messages, map[string]string{"role": role, "content": msg.Text})
+	}
+	messages = append(messages, map[string]string{"role": "user", "content": prompt})
+
+	body, err := json.Marshal(map[string]any{
+		"model":    b.model,
+		"stream":   true,
+		"messages": messages,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.apiKey)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("openai request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("openai request: unexpected status %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("decode chunk: %w", err)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			select {
+			case tokens <- choice.Delta.Content:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return nil
+}
+
+// ollamaBackend talks to a local Ollama server, streaming newline-delimited
+// JSON objects from the /api/generate endpoint.
+type ollamaBackend struct {
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+func newOllamaBackend() *ollamaBackend {
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+	model := os.Getenv("MODEL")
+	if model == "" {
+		model = defaultOllamaModel
+	}
+	return &ollamaBackend{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		model:   model,
+		client:  &http.Client{},
+	}
+}
+
+func (b *ollamaBackend) Ask(ctx context.Context, prompt string, history []store.Message, tokens chan<- string) error {
+	defer close(tokens)
+
+	body, err := json.Marshal(map[string]any{
+		"model":  b.model,
+		"prompt": transcript(history, prompt),
+		"stream": true,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.baseURL+"/api/generate", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ollama request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ollama request: unexpected status %s", resp.Status)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chunk struct {
+			Response string `json:"response"`
+			Done     bool   `json:"done"`
+		}
+		if err := decoder.Decode(&chunk); err != nil {
+			break
+		}
+		if chunk.Response != "" {
+			select {
+			case tokens <- chunk.Response:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if chunk.Done {
+			break
+		}
+	}
+	return nil
+}
+
+// transcript renders history and the latest prompt as a single block of
+// text, for backends like Ollama's /api/generate that take a plain prompt
+// rather than a structured message list.
+func transcript(history []store.Message, prompt string) string {
+	var b strings.Builder
+	for _, msg := range history {
+		speaker := "Human"
+		if msg.Source == "bot" {
+			speaker = "Assistant"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", speaker, msg.Text)
+	}
+	fmt.Fprintf(&b, "Human: %s\nAssistant:", prompt)
+	return b.String()
+}
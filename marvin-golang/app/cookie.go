@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const conversationCookieName = "conversation_id"
+
+// cookieSecret signs the conversation_id cookie so that a client can't
+// forge another conversation's ID. It defaults to a random value chosen
+// at startup, which is fine for a single server process but won't
+// validate cookies issued by a different process or a prior restart; set
+// COOKIE_SECRET to a stable value to share cookies across those.
+var cookieSecret = func() []byte {
+	if secret := os.Getenv("COOKIE_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte(crand.Text())
+}()
+
+// conversationID returns the conversation ID carried by r's signed
+// cookie, minting and setting a new one on w if it is missing or invalid.
+func conversationID(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(conversationCookieName); err == nil {
+		if id, ok := verifyConversationID(cookie.Value); ok {
+			return id
+		}
+	}
+	return newConversationID(w)
+}
+
+// newConversationID mints a fresh conversation ID, sets it as a signed
+// cookie on w, and returns it.
+func newConversationID(w http.ResponseWriter) string {
+	id := crand.Text()
+	http.SetCookie(w, &http.Cookie{
+		Name:     conversationCookieName,
+		Value:    signConversationID(id),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+func signConversationID(id string) string {
+	return id + "." + hex.EncodeToString(sign(id))
+}
+
+func verifyConversationID(value string) (string, bool) {
+	id, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return "", false
+	}
+	want, err := hex.DecodeString(sig)
+	if err != nil {
+		return "", false
+	}
+	if !hmac.Equal(want, sign(id)) {
+		return "", false
+	}
+	return id, true
+}
+
+func sign(id string) []byte {
+	mac := hmac.New(sha256.New, cookieSecret)
+	mac.Write([]byte(id))
+	return mac.Sum(nil)
+}
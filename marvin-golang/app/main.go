@@ -9,22 +9,33 @@ import (
 	"html/template"
 	"io"
 	"log/slog"
-	"math/rand/v2"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/lmittmann/tint"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/tomcz/ssr-chatbots/marvin-golang/hub"
 	"github.com/tomcz/ssr-chatbots/marvin-golang/shared"
 	"github.com/tomcz/ssr-chatbots/marvin-golang/static"
+	"github.com/tomcz/ssr-chatbots/marvin-golang/store"
 	"github.com/tomcz/ssr-chatbots/marvin-golang/templates"
 )
 
+// defaultChannel is used when a client connects to /ws/chat without
+// naming a channel.
+const defaultChannel = "lobby"
+
+// historyLen is how many rendered messages each channel retains for late
+// joiners fetching GET /channel/{name}/history.
+const historyLen = 50
+
 // provided by go build
 var commit string
 
@@ -36,16 +47,39 @@ func main() {
 	}
 	slog.SetDefault(slog.New(tint.NewHandler(os.Stderr, opts)))
 
+	backend, err := newBackend()
+	if err != nil {
+		slog.Error("newBackend", "error", err)
+		os.Exit(1)
+	}
+	chatBackend = backend
+
+	chatStore, err = newStore()
+	if err != nil {
+		slog.Error("newStore", "error", err)
+		os.Exit(1)
+	}
+
 	listenAddr := os.Getenv("LISTEN_ADDR")
 	if listenAddr == "" {
 		listenAddr = "127.0.0.1:3000"
 	}
-	if err := runServer(listenAddr, newHandler()); err != nil {
+	shutdownTimeout := envDuration("SHUTDOWN_TIMEOUT", 10*time.Second)
+	if err := runServer(listenAddr, newHandler(), shutdownTimeout); err != nil {
 		slog.Error("server failed", "error", err)
 		os.Exit(1)
 	}
 }
 
+// chatBackend answers chat questions, selected once at startup via newBackend.
+var chatBackend Backend
+
+// chatStore persists conversations, selected once at startup via newStore.
+var chatStore store.Store
+
+// chatHub fans rendered messages out to every subscriber of a channel.
+var chatHub = hub.New(historyLen)
+
 func highlightErrors(_ []string, attr slog.Attr) slog.Attr {
 	if attr.Value.Kind() == slog.KindAny {
 		if _, ok := attr.Value.Any().(error); ok {
@@ -55,7 +89,7 @@ func highlightErrors(_ []string, attr slog.Attr) slog.Attr {
 	return attr
 }
 
-func runServer(listenAddr string, handler http.Handler) error {
+func runServer(listenAddr string, handler http.Handler, shutdownTimeout time.Duration) error {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
@@ -68,8 +102,9 @@ func runServer(listenAddr string, handler http.Handler) error {
 	})
 	group.Go(func() error {
 		<-ctx.Done()
-		slog.Info("stopping server")
-		timeout, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		slog.Info("stopping server", "shutdown_timeout", shutdownTimeout)
+		liveChats.drain(shutdownTimeout)
+		timeout, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 		defer cancel()
 		return server.Shutdown(timeout)
 	})
@@ -85,11 +120,18 @@ func runServer(listenAddr string, handler http.Handler) error {
 func newHandler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/{$}", index)
-	mux.HandleFunc("/ws/chat", chat)
+	mux.HandleFunc("/conversations", conversations)
+	mux.HandleFunc("/conversations/new", newChat)
+	mux.Handle("/ws/chat", ipLimiter.limit(limitConcurrency(http.HandlerFunc(chat))))
+	mux.Handle("/ws/chat/{channel}", ipLimiter.limit(limitConcurrency(http.HandlerFunc(chat))))
+	mux.HandleFunc("/channel/{channel}/history", channelHistory)
+	mux.Handle("POST /chat", ipLimiter.limit(limitConcurrency(http.HandlerFunc(postChat))))
+	mux.Handle("GET /events/{chatID}", limitConcurrency(http.HandlerFunc(sseEvents)))
+	mux.Handle("/metrics", promhttp.Handler())
 	prefix := fmt.Sprintf("/static/%s/", commit)
 	mux.Handle("/static/", staticCacheControl(static.Embedded, http.StripPrefix(prefix, http.FileServer(static.FS))))
 	mux.Handle("/shared/", staticCacheControl(true, http.StripPrefix("/shared/", http.FileServer(shared.FS))))
-	return mux
+	return authMiddleware(mux)
 }
 
 func staticCacheControl(embedded bool, next http.Handler) http.Handler {
@@ -130,12 +172,63 @@ type chatInput struct {
 	Question string `json:"question"`
 }
 
-func index(w http.ResponseWriter, _ *http.Request) {
-	writeResponse(w, "index.gohtml", "main", nil)
+func index(w http.ResponseWriter, r *http.Request) {
+	convID := conversationID(w, r)
+
+	history, err := chatStore.LoadConversation(r.Context(), convID)
+	if err != nil {
+		slog.Error("LoadConversation", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rendered := make([]template.HTML, 0, len(history))
+	for _, msg := range history {
+		html, err := renderMessage(msg.Text, msg.Source, "", false)
+		if err != nil {
+			slog.Error("renderMessage", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rendered = append(rendered, template.HTML(html))
+	}
+
+	writeResponse(w, "index.gohtml", "main", map[string]any{
+		"ConversationID": convID,
+		"History":        rendered,
+	})
+}
+
+// conversations lists every conversation ever started, so a user can jump
+// back into one.
+func conversations(w http.ResponseWriter, r *http.Request) {
+	list, err := chatStore.ListConversations(r.Context())
+	if err != nil {
+		slog.Error("ListConversations", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeResponse(w, "conversations.gohtml", "main", map[string]any{
+		"Conversations": list,
+	})
+}
+
+// newChat mints a fresh conversation ID and sends the user back to a blank
+// index page, backing the "new chat" button.
+func newChat(w http.ResponseWriter, r *http.Request) {
+	newConversationID(w)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func chat(w http.ResponseWriter, r *http.Request) {
-	log := slog.With("chat_id", crand.Text())
+	channel := r.PathValue("channel")
+	if channel == "" {
+		channel = defaultChannel
+	}
+	// conversationID must be resolved before Upgrade hijacks the
+	// connection: afterwards w can no longer carry response headers, so
+	// a cookie minted here would silently go nowhere.
+	convID := conversationID(w, r)
+	log := slog.With("chat_id", crand.Text(), "channel", channel, "conversation_id", convID)
 	log.Info("starting chat")
 
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -145,43 +238,202 @@ func chat(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	err = writeMessage(conn, "Hello, I am Marvin.", "bot", "")
-	if err != nil {
-		log.Error("writeMessage", "error", err)
+	session := Session{Channel: channel, ConversationID: convID}
+	sub := wsSubscriber{conn: conn}
+
+	defer liveChats.add(channel, sub)()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	if err = session.Greet(sub); err != nil {
+		log.Error("Greet", "error", err)
 		return
 	}
 
-	for {
-		var req chatInput
-		if err = conn.ReadJSON(&req); err != nil {
-			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-				log.Info("stopping chat", "error", err)
-				break
+	chatHub.Join(channel, sub)
+	defer chatHub.Leave(channel, sub)
+
+	// conn.ReadJSON runs on its own goroutine, which cancels ctx as soon as
+	// the connection drops, even while the main goroutine is still blocked
+	// inside session.Ask streaming a backend answer: r.Context() doesn't
+	// cancel on disconnect once the request has been hijacked by Upgrade.
+	// This does not abort the answer in flight, since session.Ask is given
+	// a context without ctx's cancellation (see below).
+	questions := make(chan chatInput)
+	go func() {
+		defer close(questions)
+		defer cancel()
+		for {
+			var req chatInput
+			if err := conn.ReadJSON(&req); err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					log.Info("stopping chat", "error", err)
+				} else {
+					log.Error("ws.ReadJSON", "error", err)
+				}
+				return
+			}
+			select {
+			case questions <- req:
+			case <-ctx.Done():
+				return
 			}
-			log.Error("ws.ReadJSON", "error", err)
-			break
 		}
-		if err = writeMessage(conn, req.Question, "human", ""); err != nil {
-			log.Error("writeMessage", "error", err)
-			break
+	}()
+
+	ip := remoteIP(r)
+	for req := range questions {
+		// ipLimiter.limit only guards the upgrade handshake; without this
+		// check a client could open one socket and then flood it with
+		// unlimited messages.
+		if !ipLimiter.allow(ip) {
+			rejectedTotal.WithLabelValues("rate_limited").Inc()
+			if msg, err := renderMessage("Slow down, I can only process so much despair at once.", "bot", "", false); err == nil {
+				_ = sub.Send(msg)
+			}
+			continue
 		}
-		resID := "res-" + crand.Text()
-		err = writeMessage(conn, "thinking", "bot", resID)
-		if err != nil {
-			log.Error("writeMessage", "error", err)
+		// Ask broadcasts to every subscriber of the channel, not just this
+		// connection, so its lifetime must outlive this one socket: strip
+		// ctx's cancellation before handing it off, otherwise this asker
+		// disconnecting would cut the bot's answer off mid-sentence for
+		// everyone else still in the room.
+		if err := session.Ask(context.WithoutCancel(ctx), req.Question); err != nil {
+			log.Error("session.Ask", "error", err)
 			break
 		}
-		time.Sleep(2 * time.Second) // pretend to be a busy LLM
-		msg := cannedResponses[rand.IntN(len(cannedResponses))]
-		err = writeMessage(conn, msg, "bot", resID)
-		if err != nil {
-			log.Error("writeMessage", "error", err)
-			break
+	}
+}
+
+// postChat handles the SSE chat transport's question half: the answer is
+// streamed separately to every GET /events/{chatID} subscriber of the same
+// channel, including the poster's own.
+func postChat(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	channel := r.FormValue("chat_id")
+	if channel == "" {
+		channel = defaultChannel
+	}
+	convID := conversationID(w, r)
+	log := slog.With("channel", channel, "conversation_id", convID)
+
+	session := Session{Channel: channel, ConversationID: convID}
+	// Ask broadcasts to every subscriber of the channel, so it must outlive
+	// this one HTTP request: strip r.Context()'s cancellation before
+	// handing it off, otherwise the poster going away mid-request would
+	// cut the bot's answer off for every GET /events/{chatID} subscriber.
+	if err := session.Ask(context.WithoutCancel(r.Context()), r.FormValue("question")); err != nil {
+		log.Error("session.Ask", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sseEvents handles the SSE chat transport's answer half, pushing every
+// rendered fragment broadcast to chatID as a "data:" SSE event for htmx's
+// SSE extension to swap into the DOM.
+func sseEvents(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("chatID")
+	if channel == "" {
+		channel = defaultChannel
+	}
+	log := slog.With("sse_id", crand.Text(), "channel", channel)
+	log.Info("starting sse stream")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-store")
+	header.Set("Connection", "keep-alive")
+
+	session := Session{Channel: channel}
+	sub := sseSubscriber{w: w, flusher: flusher}
+
+	if err := session.Greet(sub); err != nil {
+		log.Error("Greet", "error", err)
+		return
+	}
+
+	chatHub.Join(channel, sub)
+	defer chatHub.Leave(channel, sub)
+
+	<-r.Context().Done()
+	log.Info("stopping sse stream")
+}
+
+func channelHistory(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+	if channel == "" {
+		channel = defaultChannel
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	for _, msg := range chatHub.History(channel) {
+		fmt.Fprint(w, msg)
+	}
+}
+
+// askBackend streams chatBackend's answer to every subscriber of channel,
+// appending each chunk to the same resID so the browser renders the reply
+// as it arrives, and returns the full answer for persistence.
+func askBackend(ctx context.Context, channel, question string, history []store.Message) (string, error) {
+	messagesTotal.Inc()
+	start := time.Now()
+	defer func() { backendLatency.Observe(time.Since(start).Seconds()) }()
+
+	resID := "res-" + crand.Text()
+	if err := broadcastMessage(channel, "thinking", "bot", resID, false); err != nil {
+		return "", fmt.Errorf("broadcastMessage: %w", err)
+	}
+
+	tokens := make(chan string)
+	askCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var askErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		askErr = chatBackend.Ask(askCtx, question, history, tokens)
+	}()
+
+	var answer strings.Builder
+	first := true
+	for token := range tokens {
+		if err := broadcastMessage(channel, token, "bot", resID, !first); err != nil {
+			return "", fmt.Errorf("broadcastMessage: %w", err)
 		}
+		answer.WriteString(token)
+		first = false
+	}
+	<-done
+	if askErr != nil && !errors.Is(askErr, context.Canceled) {
+		return "", fmt.Errorf("backend.Ask: %w", askErr)
 	}
+	return answer.String(), nil
 }
 
-func writeMessage(conn *websocket.Conn, message, source, resID string) error {
+// broadcastMessage renders message and queues it for delivery to every
+// subscriber of channel.
+func broadcastMessage(channel, message, source, resID string, appendMessage bool) error {
+	msg, err := renderMessage(message, source, resID, appendMessage)
+	if err != nil {
+		return err
+	}
+	chatHub.Broadcast(channel, msg)
+	return nil
+}
+
+func renderMessage(message, source, resID string, appendMessage bool) (string, error) {
 	mType := "bot-message"
 	tmplName := "chat-output"
 	if source != "bot" {
@@ -193,16 +445,13 @@ func writeMessage(conn *websocket.Conn, message, source, resID string) error {
 		"Source": source,
 		"Text":   message,
 		"ResID":  resID,
+		"Append": appendMessage,
 	}
 	msg, err := render("index.gohtml", tmplName, data)
 	if err != nil {
-		return fmt.Errorf("render: %w", err)
+		return "", fmt.Errorf("render: %w", err)
 	}
-	err = conn.WriteMessage(websocket.TextMessage, []byte(msg))
-	if err != nil {
-		return fmt.Errorf("ws.WriteMessage: %w", err)
-	}
-	return nil
+	return msg, nil
 }
 
 func writeResponse(w http.ResponseWriter, templateFile string, templateName string, data map[string]any) {
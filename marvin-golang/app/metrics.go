@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	activeChats = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "marvin_active_chats",
+		Help: "Number of currently active chat connections (WebSocket and SSE).",
+	})
+
+	messagesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "marvin_messages_total",
+		Help: "Total number of chat messages processed.",
+	})
+
+	backendLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "marvin_backend_latency_seconds",
+		Help:    "Latency of Backend.Ask calls, from question to final token.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	rejectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "marvin_rejected_total",
+		Help: "Total number of requests and WebSocket chat messages rejected by auth, rate limiting or the concurrency cap.",
+	}, []string{"reason"})
+)
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitRPS and rateLimitBurst configure the per-IP token bucket
+// guarding /ws/chat upgrades and POST /chat message posts.
+var (
+	rateLimitRPS   = envFloat("RATE_LIMIT_RPS", 1)
+	rateLimitBurst = envInt("RATE_LIMIT_BURST", 5)
+)
+
+// maxConcurrentChats bounds how many WebSocket and SSE chat connections
+// may be active at once.
+var maxConcurrentChats = envInt("MAX_CONCURRENT_CHATS", 200)
+
+// rateLimitIdleTTL bounds how long an IP's rate.Limiter is kept around
+// after its last request, so a long-running server doesn't accumulate one
+// entry per distinct client forever.
+var rateLimitIdleTTL = envDuration("RATE_LIMIT_IDLE_TTL", 10*time.Minute)
+
+// rateLimitSweepInterval is how often ipRateLimiter checks for idle
+// entries to evict.
+const rateLimitSweepInterval = time.Minute
+
+func envFloat(name string, fallback float64) float64 {
+	if v := os.Getenv(name); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
+
+func envInt(name string, fallback int) int {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(name); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+// ipLimiterEntry is a per-IP token bucket plus when it was last used, so
+// ipRateLimiter can evict entries nobody's used in a while.
+type ipLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipRateLimiter hands out a token-bucket rate.Limiter per remote IP,
+// evicting entries idle for longer than rateLimitIdleTTL so the map
+// doesn't grow without bound over the life of the process.
+type ipRateLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*ipLimiterEntry
+}
+
+func newIPRateLimiter() *ipRateLimiter {
+	l := &ipRateLimiter{limiters: make(map[string]*ipLimiterEntry)}
+	go l.evictIdle()
+	return l
+}
+
+// ipLimiter guards every per-IP-limited entry point: the /ws/chat and
+// POST /chat handshakes, and each individual message sent over an
+// already-open /ws/chat socket (see chat's read loop), so a client can't
+// bypass the limit just by keeping one connection open.
+var ipLimiter = newIPRateLimiter()
+
+func (l *ipRateLimiter) allow(ip string) bool {
+	l.mu.Lock()
+	entry, ok := l.limiters[ip]
+	if !ok {
+		entry = &ipLimiterEntry{limiter: rate.NewLimiter(rate.Limit(rateLimitRPS), rateLimitBurst)}
+		l.limiters[ip] = entry
+	}
+	entry.lastSeen = time.Now()
+	limiter := entry.limiter
+	l.mu.Unlock()
+	return limiter.Allow()
+}
+
+// evictIdle periodically removes entries that haven't been used within
+// rateLimitIdleTTL. It runs for the lifetime of the process, same as the
+// ipRateLimiter it belongs to.
+func (l *ipRateLimiter) evictIdle() {
+	ticker := time.NewTicker(rateLimitSweepInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		cutoff := now.Add(-rateLimitIdleTTL)
+		l.mu.Lock()
+		for ip, entry := range l.limiters {
+			if entry.lastSeen.Before(cutoff) {
+				delete(l.limiters, ip)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// limit rejects requests from a remote IP that has exceeded its token
+// bucket, rendering a friendly bot message instead of calling next.
+func (l *ipRateLimiter) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.allow(remoteIP(r)) {
+			rejectedTotal.WithLabelValues("rate_limited").Inc()
+			busyResponse(w, "Slow down, I can only process so much despair at once.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// chatSemaphore caps the number of concurrently active chat connections
+// (WebSocket and SSE) so a burst of clients can't exhaust server resources.
+var chatSemaphore = make(chan struct{}, maxConcurrentChats)
+
+// limitConcurrency rejects a new chat connection with a friendly rendered
+// message once chatSemaphore is full, otherwise holds a slot and tracks
+// activeChats for the lifetime of the request.
+func limitConcurrency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case chatSemaphore <- struct{}{}:
+		default:
+			rejectedTotal.WithLabelValues("busy").Inc()
+			busyResponse(w, "Server busy. Everything is busy, if you think about it.")
+			return
+		}
+		defer func() { <-chatSemaphore }()
+
+		activeChats.Inc()
+		defer activeChats.Dec()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func busyResponse(w http.ResponseWriter, message string) {
+	msg, err := renderMessage(message, "bot", "", false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprint(w, msg)
+}
+
+// authMiddleware gates every request behind a bearer token or HTTP Basic
+// credential, configured via AUTH_BEARER_TOKEN or AUTH_BASIC_USER /
+// AUTH_BASIC_PASS. With none of those set, it's a no-op, so the demo stays
+// open by default.
+func authMiddleware(next http.Handler) http.Handler {
+	token := os.Getenv("AUTH_BEARER_TOKEN")
+	user := os.Getenv("AUTH_BASIC_USER")
+	pass := os.Getenv("AUTH_BASIC_PASS")
+	if token == "" && user == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && constantTimeEqual(r.Header.Get("Authorization"), "Bearer "+token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if user != "" {
+			if u, p, ok := r.BasicAuth(); ok && constantTimeEqual(u, user) && constantTimeEqual(p, pass) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		rejectedTotal.WithLabelValues("auth").Inc()
+		w.Header().Set("WWW-Authenticate", `Basic realm="marvin"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// constantTimeEqual compares got and want in time independent of where
+// they first differ, so a bearer token or Basic credential can't be
+// brute-forced byte-by-byte via response timing.
+func constantTimeEqual(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
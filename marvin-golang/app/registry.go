@@ -0,0 +1,106 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/tomcz/ssr-chatbots/marvin-golang/hub"
+)
+
+// chatEntry identifies one live chat connection by the hub channel and
+// subscriber it joined with, so drain can ask chatHub to notify and close
+// it through the same single-writer goroutine that ordinary broadcasts use.
+type chatEntry struct {
+	channel string
+	sub     hub.Subscriber
+}
+
+// forceCloser is implemented by Subscribers that can be closed immediately,
+// bypassing chatHub's single-writer delivery path. Used only once a
+// graceful drain has already timed out and the process is on its way down.
+type forceCloser interface {
+	ForceClose() error
+}
+
+// chatRegistry tracks every live WebSocket chat connection so the server
+// can notify and wait for them to drain during a graceful shutdown.
+type chatRegistry struct {
+	mu      sync.Mutex
+	entries map[chatEntry]struct{}
+	wg      sync.WaitGroup
+}
+
+// liveChats is the process-wide registry of active chat connections.
+var liveChats = &chatRegistry{entries: make(map[chatEntry]struct{})}
+
+// add registers sub, joined to channel, as live and returns a func that
+// deregisters it; call the returned func (typically via defer) once the
+// chat handler returns.
+func (r *chatRegistry) add(channel string, sub hub.Subscriber) func() {
+	entry := chatEntry{channel: channel, sub: sub}
+	r.wg.Add(1)
+	r.mu.Lock()
+	r.entries[entry] = struct{}{}
+	r.mu.Unlock()
+	return func() {
+		r.mu.Lock()
+		delete(r.entries, entry)
+		r.mu.Unlock()
+		r.wg.Done()
+	}
+}
+
+// drain sends every live connection a rendered "server restarting" message
+// followed by a close request, both routed through chatHub so they're
+// never written to a connection concurrently with an ordinary broadcast,
+// then waits up to timeout for their handlers to return before force-
+// closing whatever remains.
+func (r *chatRegistry) drain(timeout time.Duration) {
+	r.mu.Lock()
+	entries := make([]chatEntry, 0, len(r.entries))
+	for entry := range r.entries {
+		entries = append(entries, entry)
+	}
+	r.mu.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+	slog.Info("draining active chats", "count", len(entries), "timeout", timeout)
+
+	const reason = "server restarting"
+	msg, err := renderMessage("Server restarting. I did warn you this would all end in tears.", "bot", "", false)
+	if err != nil {
+		slog.Error("renderMessage", "error", err)
+	}
+	for _, entry := range entries {
+		if msg != "" {
+			chatHub.Send(entry.channel, entry.sub, msg)
+		}
+		chatHub.CloseSubscriber(entry.channel, entry.sub, reason)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("all chats drained")
+	case <-time.After(timeout):
+		r.mu.Lock()
+		remaining := make([]chatEntry, 0, len(r.entries))
+		for entry := range r.entries {
+			remaining = append(remaining, entry)
+		}
+		r.mu.Unlock()
+		for _, entry := range remaining {
+			if fc, ok := entry.sub.(forceCloser); ok {
+				_ = fc.ForceClose()
+			}
+		}
+		slog.Warn("shutdown timeout reached, forced remaining chats closed", "remaining", len(remaining))
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tomcz/ssr-chatbots/marvin-golang/hub"
+)
+
+// Session drives one channel's question/answer cycle independent of the
+// transport (WebSocket, SSE, ...) that delivers rendered fragments to the
+// browser. All delivery goes through chatHub, so every transport that has
+// joined the channel sees the same broadcasts.
+//
+// Channel and ConversationID answer different questions: Channel is which
+// room's broadcasts this session takes part in, while ConversationID is
+// whose persisted history (store.Store key) it reads and appends to. They
+// are independent values: Channel comes from the request (defaultChannel
+// when none is named) while ConversationID comes from the browser's signed
+// cookie, so each participant keeps their own conversation history even
+// though they're all talking in the same room.
+type Session struct {
+	Channel        string
+	ConversationID string
+}
+
+// Greet renders the bot's opening line directly to sub, for use before sub
+// has joined the channel and so isn't reachable via chatHub yet.
+func (s Session) Greet(sub hub.Subscriber) error {
+	msg, err := renderMessage("Hello, I am Marvin.", "bot", "", false)
+	if err != nil {
+		return err
+	}
+	return sub.Send(msg)
+}
+
+// Ask renders and broadcasts question, then streams chatBackend's answer
+// to every subscriber of the channel, persisting both turns to chatStore.
+// ctx should not be tied to the asker's own connection: Ask's effects are
+// broadcast to the whole channel, so one subscriber disconnecting must not
+// cut the answer off for the rest of the room. Callers pass a
+// context.WithoutCancel'd context for exactly this reason.
+func (s Session) Ask(ctx context.Context, question string) error {
+	history, err := chatStore.LoadConversation(ctx, s.ConversationID)
+	if err != nil {
+		return fmt.Errorf("LoadConversation: %w", err)
+	}
+	if err = broadcastMessage(s.Channel, question, "human", "", false); err != nil {
+		return err
+	}
+	if err = chatStore.AppendMessage(ctx, s.ConversationID, "human", question); err != nil {
+		return fmt.Errorf("AppendMessage: %w", err)
+	}
+	answer, err := askBackend(ctx, s.Channel, question, history)
+	if err != nil {
+		return err
+	}
+	if err = chatStore.AppendMessage(ctx, s.ConversationID, "bot", answer); err != nil {
+		return fmt.Errorf("AppendMessage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tomcz/ssr-chatbots/marvin-golang/store"
+)
+
+// newStore selects a store.Store implementation based on the STORE_DRIVER
+// env var. Supported values are "sqlite" and "memory" (the default).
+func newStore() (store.Store, error) {
+	switch driver := os.Getenv("STORE_DRIVER"); driver {
+	case "", "memory":
+		return store.NewMemoryStore(), nil
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "marvin.db"
+		}
+		return store.NewSQLiteStore(path)
+	default:
+		return nil, fmt.Errorf("unknown STORE_DRIVER %q", driver)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// writeTimeout bounds how long a single Send or Close may block a
+// subscriber's delivery goroutine before it's treated as a dead connection.
+const writeTimeout = 5 * time.Second
+
+// wsSubscriber adapts a *websocket.Conn to hub.Subscriber and hub.Closer.
+type wsSubscriber struct {
+	conn *websocket.Conn
+}
+
+func (s wsSubscriber) Send(msg string) error {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	return s.conn.WriteMessage(websocket.TextMessage, []byte(msg))
+}
+
+// Close sends a WebSocket close frame, so draining a connection goes
+// through the same single-writer goroutine as ordinary broadcasts instead
+// of racing a concurrent Send to the same conn.
+func (s wsSubscriber) Close(reason string) error {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	return s.conn.WriteMessage(websocket.CloseMessage, closeMsg)
+}
+
+// ForceClose closes the underlying connection immediately, bypassing the
+// single-writer delivery path entirely. Only safe to call once the process
+// is already shutting down and nothing else will ever write to the hub
+// again, e.g. a chatRegistry.drain timeout on a connection that never
+// responded to Close.
+func (s wsSubscriber) ForceClose() error {
+	return s.conn.Close()
+}
+
+// sseSubscriber adapts an http.ResponseWriter to hub.Subscriber, writing
+// each message as a "message" SSE event for htmx's SSE extension to swap
+// into the DOM.
+type sseSubscriber struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (s sseSubscriber) Send(msg string) error {
+	// best-effort: not every ResponseWriter supports a write deadline
+	_ = http.NewResponseController(s.w).SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	for _, line := range strings.Split(msg, "\n") {
+		if _, err := fmt.Fprintf(s.w, "data: %s\n", line); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprint(s.w, "\n"); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
@@ -0,0 +1,252 @@
+// Package hub provides a registry of named chat channels, fanning rendered
+// HTML fragments out to every subscriber of a channel regardless of the
+// transport (WebSocket, SSE, ...) that subscriber is using, so that
+// multiple browsers can share the same conversation.
+package hub
+
+import "sync"
+
+// broadcastBuffer bounds how far a channel's fan-out goroutine can fall
+// behind its busiest publisher before Broadcast starts blocking callers.
+const broadcastBuffer = 16
+
+// subscriberOutboxSize bounds how many messages a single subscriber can
+// fall behind the rest of the channel before further broadcasts are
+// dropped for it rather than stalling delivery to everyone else.
+const subscriberOutboxSize = 32
+
+// Subscriber receives rendered HTML fragments broadcast to a channel. Each
+// transport implements this however it delivers messages to its browser:
+// a WebSocket write, an SSE event, and so on. Implementations should apply
+// their own write deadline so a stalled connection fails fast instead of
+// hanging the goroutine that drains its outbox forever.
+type Subscriber interface {
+	Send(msg string) error
+}
+
+// Closer is implemented by Subscribers that can be told to close their
+// underlying connection. CloseSubscriber delivers the request through the
+// same per-subscriber goroutine that ordinary broadcasts use, so it never
+// races a concurrent Send to that connection.
+type Closer interface {
+	Close(reason string) error
+}
+
+// Hub tracks channels keyed by name and retains a bounded history of
+// rendered messages per channel for late joiners. A channel (its goroutine
+// and map entry) is torn down once its last subscriber leaves, so an
+// endless stream of distinct {channel} names doesn't leak either forever;
+// the tradeoff is that a channel's history is lost once it empties out and
+// is later rejoined.
+type Hub struct {
+	mu         sync.Mutex
+	channels   map[string]*channel
+	historyLen int
+}
+
+// New creates a Hub whose channels retain up to historyLen rendered
+// messages for replay via History.
+func New(historyLen int) *Hub {
+	return &Hub{
+		channels:   make(map[string]*channel),
+		historyLen: historyLen,
+	}
+}
+
+// outboxItem is either a rendered message to send or a request to close the
+// subscriber's connection, so CloseSubscriber can be queued through the
+// same per-subscriber outbox as ordinary broadcasts.
+type outboxItem struct {
+	msg         string
+	closeReason string
+	isClose     bool
+}
+
+// channel fans messages out to its subscribers. Every field is guarded by
+// the owning Hub's mutex; the fan-out goroutine (Hub.run) owns only the
+// read side of broadcast and quit.
+type channel struct {
+	broadcast chan string
+	quit      chan struct{}
+	subs      map[Subscriber]chan outboxItem
+	history   []string
+}
+
+func newChannel() *channel {
+	return &channel{
+		broadcast: make(chan string, broadcastBuffer),
+		quit:      make(chan struct{}),
+		subs:      make(map[Subscriber]chan outboxItem),
+	}
+}
+
+// run fans out every message broadcast to ch until the channel is torn
+// down by Leave. Delivery to each subscriber's outbox is non-blocking, so
+// one slow subscriber can't hold up history or delivery to the rest.
+func (h *Hub) run(ch *channel) {
+	for {
+		select {
+		case msg := <-ch.broadcast:
+			h.mu.Lock()
+			ch.history = append(ch.history, msg)
+			if len(ch.history) > h.historyLen {
+				ch.history = ch.history[len(ch.history)-h.historyLen:]
+			}
+			for _, outbox := range ch.subs {
+				select {
+				case outbox <- outboxItem{msg: msg}:
+				default:
+					// subscriber is falling behind; drop this message for
+					// it rather than stall delivery to the rest of the room
+				}
+			}
+			h.mu.Unlock()
+		case <-ch.quit:
+			return
+		}
+	}
+}
+
+// Join registers sub as a subscriber of the named channel and starts the
+// goroutine that delivers its messages in order via sub.Send.
+func (h *Hub) Join(name string, sub Subscriber) {
+	h.mu.Lock()
+	ch, ok := h.channels[name]
+	if !ok {
+		ch = newChannel()
+		h.channels[name] = ch
+		go h.run(ch)
+	}
+	outbox := make(chan outboxItem, subscriberOutboxSize)
+	ch.subs[sub] = outbox
+	h.mu.Unlock()
+
+	go h.deliver(name, ch, sub, outbox)
+}
+
+// deliver drains outbox into sub.Send (or sub.Close, for a close request),
+// one item at a time, until the outbox is closed by Leave or the send errors.
+func (h *Hub) deliver(name string, ch *channel, sub Subscriber, outbox chan outboxItem) {
+	for item := range outbox {
+		var err error
+		if item.isClose {
+			if closer, ok := sub.(Closer); ok {
+				err = closer.Close(item.closeReason)
+			}
+		} else {
+			err = sub.Send(item.msg)
+		}
+		if err != nil {
+			h.leave(name, ch, sub)
+			return
+		}
+	}
+}
+
+// Leave removes sub from the named channel's subscriber set, tearing the
+// channel down once it has no subscribers left. It is safe to call even if
+// sub was already removed by a failed send.
+func (h *Hub) Leave(name string, sub Subscriber) {
+	h.mu.Lock()
+	ch, ok := h.channels[name]
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+	h.leave(name, ch, sub)
+}
+
+func (h *Hub) leave(name string, ch *channel, sub Subscriber) {
+	h.mu.Lock()
+	outbox, existed := ch.subs[sub]
+	if existed {
+		delete(ch.subs, sub)
+	}
+	last := existed && len(ch.subs) == 0
+	if last && h.channels[name] == ch {
+		delete(h.channels, name)
+	}
+	h.mu.Unlock()
+
+	if existed {
+		close(outbox)
+	}
+	if last {
+		close(ch.quit)
+	}
+}
+
+// Broadcast queues the rendered HTML fragment msg for delivery to every
+// current subscriber of the named channel. A channel with no subscribers
+// doesn't exist, so msg is then dropped and not kept in any history.
+func (h *Hub) Broadcast(name string, msg string) {
+	h.mu.Lock()
+	ch, ok := h.channels[name]
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+	ch.broadcast <- msg
+}
+
+// Send delivers msg to exactly one subscriber of the named channel, via the
+// same per-subscriber outbox ordinary broadcasts use, so it is never issued
+// concurrently with a channel broadcast to that subscriber. If sub's outbox
+// is full, msg is dropped. It reports whether sub was a known subscriber of
+// the channel, whether or not msg was dropped.
+func (h *Hub) Send(name string, sub Subscriber, msg string) bool {
+	outbox, ok := h.outboxFor(name, sub)
+	if !ok {
+		return false
+	}
+	select {
+	case outbox <- outboxItem{msg: msg}:
+	default:
+	}
+	return true
+}
+
+// CloseSubscriber asks sub to close its connection, if it implements
+// Closer, from within the same per-subscriber goroutine that delivers
+// ordinary broadcasts, so the close never races a concurrent Send to the
+// same connection. If sub's outbox is full, the request is dropped. It
+// reports whether sub was a known subscriber.
+func (h *Hub) CloseSubscriber(name string, sub Subscriber, reason string) bool {
+	if _, ok := sub.(Closer); !ok {
+		return false
+	}
+	outbox, ok := h.outboxFor(name, sub)
+	if !ok {
+		return false
+	}
+	select {
+	case outbox <- outboxItem{isClose: true, closeReason: reason}:
+	default:
+	}
+	return true
+}
+
+func (h *Hub) outboxFor(name string, sub Subscriber) (chan outboxItem, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch, ok := h.channels[name]
+	if !ok {
+		return nil, false
+	}
+	outbox, ok := ch.subs[sub]
+	return outbox, ok
+}
+
+// History returns the rendered messages retained for the named channel,
+// oldest first, or nil if the channel doesn't currently exist.
+func (h *Hub) History(name string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch, ok := h.channels[name]
+	if !ok {
+		return nil
+	}
+	out := make([]string, len(ch.history))
+	copy(out, ch.history)
+	return out
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore is an in-memory Store. All state is lost on restart, which
+// makes it a good default for local development.
+type memoryStore struct {
+	mu            sync.Mutex
+	messages      map[string][]Message
+	conversations map[string]Conversation
+}
+
+// NewMemoryStore creates a Store that keeps every conversation in memory.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		messages:      make(map[string][]Message),
+		conversations: make(map[string]Conversation),
+	}
+}
+
+func (s *memoryStore) AppendMessage(_ context.Context, conversationID, source, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.conversations[conversationID]; !ok {
+		s.conversations[conversationID] = Conversation{ID: conversationID, CreatedAt: time.Now()}
+	}
+	s.messages[conversationID] = append(s.messages[conversationID], Message{
+		ConversationID: conversationID,
+		Source:         source,
+		Text:           text,
+		CreatedAt:      time.Now(),
+	})
+	return nil
+}
+
+func (s *memoryStore) LoadConversation(_ context.Context, conversationID string) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Message, len(s.messages[conversationID]))
+	copy(out, s.messages[conversationID])
+	return out, nil
+}
+
+func (s *memoryStore) ListConversations(_ context.Context) ([]Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Conversation, 0, len(s.conversations))
+	for _, c := range s.conversations {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
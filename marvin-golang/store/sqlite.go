@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // pure-Go driver, avoids CGO
+)
+
+// sqliteStore is a SQLite-backed Store, suitable for a single server
+// process that wants its conversations to survive a restart.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (creating if necessary) the SQLite database at path
+// and brings its schema up to date.
+func NewSQLiteStore(path string) (Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite.Open: %w", err)
+	}
+	if err = migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS conversations (
+			id         TEXT PRIMARY KEY,
+			created_at DATETIME NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS messages (
+			conversation_id TEXT NOT NULL,
+			source          TEXT NOT NULL,
+			text            TEXT NOT NULL,
+			created_at      DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS messages_conversation_id ON messages (conversation_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) AppendMessage(ctx context.Context, conversationID, source, text string) error {
+	now := time.Now()
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO conversations (id, created_at) VALUES (?, ?) ON CONFLICT (id) DO NOTHING`,
+		conversationID, now)
+	if err != nil {
+		return fmt.Errorf("insert conversation: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO messages (conversation_id, source, text, created_at) VALUES (?, ?, ?, ?)`,
+		conversationID, source, text, now)
+	if err != nil {
+		return fmt.Errorf("insert message: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) LoadConversation(ctx context.Context, conversationID string) ([]Message, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT conversation_id, source, text, created_at FROM messages WHERE conversation_id = ? ORDER BY created_at`,
+		conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("select messages: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Message
+	for rows.Next() {
+		var m Message
+		if err = rows.Scan(&m.ConversationID, &m.Source, &m.Text, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan message: %w", err)
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteStore) ListConversations(ctx context.Context) ([]Conversation, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, created_at FROM conversations ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("select conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Conversation
+	for rows.Next() {
+		var c Conversation
+		if err = rows.Scan(&c.ID, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan conversation: %w", err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
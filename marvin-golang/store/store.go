@@ -0,0 +1,34 @@
+// Package store persists chat conversations so that a browser's history
+// survives page reloads and, with the SQLite store, server restarts.
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Message is a single turn in a conversation.
+type Message struct {
+	ConversationID string
+	Source         string // "human" or "bot"
+	Text           string
+	CreatedAt      time.Time
+}
+
+// Conversation summarises a conversation for listing.
+type Conversation struct {
+	ID        string
+	CreatedAt time.Time
+}
+
+// Store persists chat conversations.
+type Store interface {
+	// AppendMessage records a new message in the named conversation,
+	// creating the conversation if this is its first message.
+	AppendMessage(ctx context.Context, conversationID, source, text string) error
+	// LoadConversation returns every message in the named conversation,
+	// oldest first.
+	LoadConversation(ctx context.Context, conversationID string) ([]Message, error)
+	// ListConversations returns every known conversation, newest first.
+	ListConversations(ctx context.Context) ([]Conversation, error)
+}